@@ -0,0 +1,213 @@
+// Package apparmor allows to materialize AppArmor profile fragments and
+// abstractions shipped by GPOs, and to load or remove them via apparmor_parser.
+package apparmor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/ubuntu/adsys/internal/decorate"
+	log "github.com/ubuntu/adsys/internal/grpc/logstreamer"
+	"github.com/ubuntu/adsys/internal/i18n"
+	"github.com/ubuntu/adsys/internal/policies/entry"
+)
+
+// defaultApparmorDir is used when no personalized directory is given to the manager.
+const defaultApparmorDir = "/etc/apparmor.d/adsys.d"
+
+// Manager materializes AppArmor profiles and abstractions for a given object
+// and (re)loads them with apparmor_parser.
+type Manager struct {
+	apparmorDir string
+	dryRun      bool
+}
+
+// NewWithDir returns a new manager with a personalized AppArmor profile directory.
+func NewWithDir(p string) *Manager {
+	if p == "" {
+		p = defaultApparmorDir
+	}
+	return &Manager{
+		apparmorDir: p,
+	}
+}
+
+// WithDryRun prevents the manager from invoking apparmor_parser, for use in tests.
+func WithDryRun(m *Manager) {
+	m.dryRun = true
+}
+
+// ValidateKey reports whether key is safe to use as a profile file name under
+// objectDir, as expected by ApplyPolicy. Keys come from GPO entries and must
+// not be allowed to escape objectDir via a path separator or "..".
+func ValidateKey(key string) error {
+	if key == "" {
+		return errors.New(i18n.G("key is empty"))
+	}
+	if key != filepath.Base(key) || key == "." || key == ".." {
+		return fmt.Errorf(i18n.G("key %q must be a plain file name, not a path"), key)
+	}
+	return nil
+}
+
+// ApplyPolicy generates the profile and abstraction fragments for objectName,
+// unloads any stale profile that is no longer part of the policy with
+// apparmor_parser -R and reloads the remaining ones with apparmor_parser -r.
+func (m *Manager) ApplyPolicy(ctx context.Context, objectName string, isComputer bool, entries []entry.Entry) (err error) {
+	defer decorate.OnError(&err, i18n.G("can't apply apparmor policy to %q"), objectName)
+
+	log.Debugf(ctx, "Applying apparmor policy to %s (machine: %v)", objectName, isComputer)
+
+	objectDir := filepath.Join(m.apparmorDir, objectName)
+
+	desired := make(map[string]bool)
+	for _, e := range entries {
+		if e.Disabled {
+			continue
+		}
+		if err := ValidateKey(e.Key); err != nil {
+			continue
+		}
+		desired[e.Key] = true
+	}
+	if err := m.unloadStaleProfiles(ctx, objectDir, desired); err != nil {
+		return err
+	}
+
+	if err := os.RemoveAll(objectDir); err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+
+	if err := os.MkdirAll(objectDir, 0700); err != nil {
+		return err
+	}
+
+	var profiles []string
+	for _, e := range entries {
+		if e.Disabled {
+			continue
+		}
+		if err := ValidateKey(e.Key); err != nil {
+			log.Warningf(ctx, "ignoring invalid apparmor entry %q: %v", e.Key, err)
+			continue
+		}
+		profilePath := filepath.Join(objectDir, e.Key)
+		if err := os.WriteFile(profilePath, []byte(e.Value), 0600); err != nil {
+			return err
+		}
+		profiles = append(profiles, profilePath)
+	}
+
+	if len(profiles) == 0 {
+		// Every entry was disabled or had an invalid key: objectDir was just created for nothing, so
+		// drop it again instead of leaving a dead empty directory behind.
+		return os.RemoveAll(objectDir)
+	}
+
+	// Profiles must be loaded into the kernel before aa-exec can switch into them,
+	// so both scopes reload them; only the wrapper step differs.
+	if err := m.reload(ctx, profiles); err != nil {
+		return err
+	}
+
+	if !isComputer {
+		// User-scope profiles are switched into on session start via aa-exec wrappers
+		// rather than applied machine-wide to running processes.
+		return m.writeUserWrappers(objectDir, profiles)
+	}
+
+	return nil
+}
+
+// writeUserWrappers drops one aa-exec wrapper script per profile into the user's
+// object directory, so the user session can confine processes under the matching
+// profile once ApplyPolicy has loaded it with apparmor_parser.
+func (m *Manager) writeUserWrappers(objectDir string, profiles []string) error {
+	for _, p := range profiles {
+		profileName := filepath.Base(p)
+		wrapperPath := filepath.Join(objectDir, profileName+".wrapper")
+		wrapper := fmt.Sprintf("#!/bin/sh\nexec aa-exec -p %s -- \"$@\"\n", profileName)
+		if err := os.WriteFile(wrapperPath, []byte(wrapper), 0700); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reload (re)loads the given profiles with apparmor_parser -r, unless the
+// manager was created with WithDryRun.
+func (m *Manager) reload(ctx context.Context, profiles []string) (err error) {
+	defer decorate.OnError(&err, i18n.G("can't reload apparmor profiles"))
+
+	if m.dryRun {
+		log.Debug(ctx, "Dry run: not invoking apparmor_parser")
+		return nil
+	}
+
+	args := append([]string{"-r"}, profiles...)
+	// #nosec G204 - profiles are files we just wrote under our own managed directory.
+	cmd := exec.CommandContext(ctx, "apparmor_parser", args...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf(i18n.G("apparmor_parser failed: %v\n%s"), err, out)
+	}
+
+	return nil
+}
+
+// unloadStaleProfiles removes, via apparmor_parser -R, any profile previously
+// materialized under objectDir whose key is not in desired, so a profile
+// dropped from the GPO actually stops being enforced instead of merely
+// disappearing from disk. It is a no-op if objectDir doesn't exist yet.
+func (m *Manager) unloadStaleProfiles(ctx context.Context, objectDir string, desired map[string]bool) error {
+	des, err := os.ReadDir(objectDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	var stale []string
+	for _, de := range des {
+		name := de.Name()
+		if strings.HasSuffix(name, ".wrapper") || desired[name] {
+			continue
+		}
+		stale = append(stale, filepath.Join(objectDir, name))
+	}
+	if len(stale) == 0 {
+		return nil
+	}
+
+	return m.unload(ctx, stale)
+}
+
+// unload removes the given profiles from AppArmor's loaded-profile table with
+// apparmor_parser -R, unless the manager was created with WithDryRun.
+func (m *Manager) unload(ctx context.Context, profiles []string) (err error) {
+	defer decorate.OnError(&err, i18n.G("can't unload stale apparmor profiles"))
+
+	if m.dryRun {
+		log.Debug(ctx, "Dry run: not invoking apparmor_parser")
+		return nil
+	}
+
+	args := append([]string{"-R"}, profiles...)
+	// #nosec G204 - profiles are files we previously wrote under our own managed directory.
+	cmd := exec.CommandContext(ctx, "apparmor_parser", args...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf(i18n.G("apparmor_parser failed: %v\n%s"), err, out)
+	}
+
+	return nil
+}
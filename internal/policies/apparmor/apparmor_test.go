@@ -0,0 +1,63 @@
+package apparmor_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/ubuntu/adsys/internal/policies/apparmor"
+	"github.com/ubuntu/adsys/internal/policies/entry"
+)
+
+func TestValidateKey(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		key     string
+		wantErr bool
+	}{
+		"valid key":                     {key: "my-profile"},
+		"empty key":                     {key: "", wantErr: true},
+		"key with path separator":       {key: "sub/profile", wantErr: true},
+		"key escaping via parent dir":   {key: "../../../etc/cron.d/evil", wantErr: true},
+		"key that is just parent dir":   {key: "..", wantErr: true},
+		"key that is just current dir": {key: ".", wantErr: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			err := apparmor.ValidateKey(tc.key)
+			if tc.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestApplyPolicyRejectsPathTraversalKey(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	m := apparmor.NewWithDir(dir)
+	apparmor.WithDryRun(m)
+
+	entries := []entry.Entry{
+		{Key: "../../../etc/cron.d/evil", Value: "profile content"},
+		{Key: "legit-profile", Value: "#include <abstractions/base>"},
+	}
+
+	err := m.ApplyPolicy(context.Background(), "myhost", true, entries)
+	require.NoError(t, err)
+
+	_, err = os.Stat(filepath.Join(dir, "..", "..", "..", "etc", "cron.d", "evil"))
+	require.True(t, os.IsNotExist(err), "path traversal key must not escape the object directory")
+
+	_, err = os.Stat(filepath.Join(dir, "myhost", "legit-profile"))
+	require.NoError(t, err, "the legitimate entry should still be materialized")
+}
@@ -0,0 +1,169 @@
+// Package audit provides a structured, sinkable event stream recording why
+// each policy key ended up applied, skipped or overridden during a run.
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/syslog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/ubuntu/adsys/internal/decorate"
+	"github.com/ubuntu/adsys/internal/i18n"
+)
+
+// Override reasons recorded on events that were not applied verbatim.
+const (
+	ReasonFilteredBySubscription = "filtered by subscription"
+	ReasonOverriddenByCloserGPO  = "overridden by closer GPO"
+	ReasonAppendMerged           = "append merged"
+	ReasonSelectorMismatch       = "selector did not match host labels"
+	ReasonDisabled               = "entry disabled"
+)
+
+// Event is one structured decision taken while applying or evaluating a policy.
+type Event struct {
+	Timestamp      time.Time `json:"timestamp"`
+	ObjectName     string    `json:"object_name"`
+	IsComputer     bool      `json:"is_computer"`
+	GPOID          string    `json:"gpo_id"`
+	RuleType       string    `json:"rule_type"`
+	Key            string    `json:"key"`
+	PriorValue     string    `json:"prior_value,omitempty"`
+	NewValue       string    `json:"new_value,omitempty"`
+	Strategy       string    `json:"strategy"`
+	Applied        bool      `json:"applied"`
+	OverrideReason string    `json:"override_reason,omitempty"`
+}
+
+// Sink receives audit events as they are produced.
+type Sink interface {
+	EmitApply(ctx context.Context, event Event) error
+}
+
+// FileSink appends JSON-lines audit events to a file, rotating it once it
+// grows past maxSize bytes.
+type FileSink struct {
+	path    string
+	maxSize int64
+
+	mu sync.Mutex
+}
+
+// NewFileSink returns a Sink appending JSON-lines events to path, rotated once
+// it exceeds maxSize bytes.
+func NewFileSink(path string, maxSize int64) *FileSink {
+	return &FileSink{path: path, maxSize: maxSize}
+}
+
+// EmitApply appends event as a JSON-line to the sink's file.
+func (s *FileSink) EmitApply(ctx context.Context, event Event) (err error) {
+	defer decorate.OnError(&err, i18n.G("can't emit audit event to %s"), s.path)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.rotateIfNeeded(); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	d, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(d, '\n'))
+	return err
+}
+
+// rotateIfNeeded renames the current file aside if it has grown past maxSize.
+func (s *FileSink) rotateIfNeeded() error {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if info.Size() <= s.maxSize {
+		return nil
+	}
+	return os.Rename(s.path, fmt.Sprintf("%s.%s", s.path, time.Now().UTC().Format("20060102T150405Z")))
+}
+
+// SyslogSink forwards audit events to the local syslog daemon as JSON.
+type SyslogSink struct {
+	w *syslog.Writer
+}
+
+// NewSyslogSink returns a Sink forwarding events to the local syslog daemon.
+func NewSyslogSink() (*SyslogSink, error) {
+	w, err := syslog.New(syslog.LOG_INFO|syslog.LOG_DAEMON, "adsysd")
+	if err != nil {
+		return nil, err
+	}
+	return &SyslogSink{w: w}, nil
+}
+
+// EmitApply logs event as a single JSON line at info level.
+func (s *SyslogSink) EmitApply(ctx context.Context, event Event) error {
+	d, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return s.w.Info(string(d))
+}
+
+// DbusSignalName is the signal name used by DbusSink to broadcast audit events.
+const DbusSignalName = "com.ubuntu.Adsys.PolicyApplied"
+
+// DbusSink broadcasts audit events as D-Bus signals.
+type DbusSink struct {
+	conn *dbus.Conn
+	path dbus.ObjectPath
+}
+
+// NewDbusSink returns a Sink broadcasting events as D-Bus signals on path.
+func NewDbusSink(conn *dbus.Conn, path dbus.ObjectPath) *DbusSink {
+	return &DbusSink{conn: conn, path: path}
+}
+
+// EmitApply emits event as a single-string JSON D-Bus signal.
+func (s *DbusSink) EmitApply(ctx context.Context, event Event) error {
+	d, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return s.conn.Emit(s.path, DbusSignalName, string(d))
+}
+
+// MultiSink fans out each event to every wrapped sink, continuing past
+// individual sink errors and returning the first one encountered, if any.
+type MultiSink struct {
+	sinks []Sink
+}
+
+// NewMultiSink returns a Sink broadcasting to every one of sinks.
+func NewMultiSink(sinks ...Sink) *MultiSink {
+	return &MultiSink{sinks: sinks}
+}
+
+// EmitApply forwards event to every wrapped sink.
+func (s *MultiSink) EmitApply(ctx context.Context, event Event) error {
+	var firstErr error
+	for _, sink := range s.sinks {
+		if err := sink.EmitApply(ctx, event); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
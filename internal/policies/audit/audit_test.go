@@ -0,0 +1,72 @@
+package audit_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/ubuntu/adsys/internal/policies/audit"
+)
+
+func TestFileSinkAppendsJSONLines(t *testing.T) {
+	t.Parallel()
+
+	p := filepath.Join(t.TempDir(), "audit.log")
+	sink := audit.NewFileSink(p, 1<<20)
+
+	require.NoError(t, sink.EmitApply(context.Background(), audit.Event{ObjectName: "host1", Key: "k1"}))
+	require.NoError(t, sink.EmitApply(context.Background(), audit.Event{ObjectName: "host1", Key: "k2"}))
+
+	d, err := os.ReadFile(p)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(d)), "\n")
+	require.Len(t, lines, 2)
+	require.Contains(t, lines[0], `"key":"k1"`)
+	require.Contains(t, lines[1], `"key":"k2"`)
+}
+
+func TestFileSinkRotatesPastMaxSize(t *testing.T) {
+	t.Parallel()
+
+	p := filepath.Join(t.TempDir(), "audit.log")
+	sink := audit.NewFileSink(p, 1)
+
+	require.NoError(t, sink.EmitApply(context.Background(), audit.Event{Key: "k1"}))
+	require.NoError(t, sink.EmitApply(context.Background(), audit.Event{Key: "k2"}))
+
+	matches, err := filepath.Glob(p + ".*")
+	require.NoError(t, err)
+	require.Len(t, matches, 1, "the first file should have been rotated aside once it exceeded maxSize")
+
+	d, err := os.ReadFile(p)
+	require.NoError(t, err)
+	require.Contains(t, string(d), `"key":"k2"`)
+}
+
+type fakeSink struct {
+	events []audit.Event
+	err    error
+}
+
+func (f *fakeSink) EmitApply(ctx context.Context, event audit.Event) error {
+	f.events = append(f.events, event)
+	return f.err
+}
+
+func TestMultiSinkFansOutAndReturnsFirstError(t *testing.T) {
+	t.Parallel()
+
+	failing := &fakeSink{err: errors.New("boom")}
+	ok := &fakeSink{}
+	sink := audit.NewMultiSink(failing, ok)
+
+	err := sink.EmitApply(context.Background(), audit.Event{Key: "k1"})
+	require.ErrorContains(t, err, "boom")
+
+	require.Len(t, failing.events, 1)
+	require.Len(t, ok.events, 1, "a failing sink must not prevent the others from receiving the event")
+}
@@ -0,0 +1,30 @@
+// Package entry defines Entry, the common key/value rule type shared by every
+// policy handler (dconf, privilege, scripts, apparmor, gdm...).
+package entry
+
+// Strategy controls how entries sharing the same type and key, coming from
+// different GPOs, are combined.
+type Strategy string
+
+const (
+	// StrategyOverride is the default strategy: the closest GPO wins and
+	// further ones are discarded.
+	StrategyOverride Strategy = "override"
+	// StrategyAppend concatenates every enabled entry across GPOs, one per line,
+	// the furthest GPO's value first and the closest GPO's value last.
+	StrategyAppend Strategy = "append"
+)
+
+// Entry is a single key/value rule contributed by a GPO to a policy handler.
+type Entry struct {
+	Key      string   `yaml:"key"`
+	Value    string   `yaml:"value"`
+	Disabled bool     `yaml:"disabled,omitempty"`
+	Meta     string   `yaml:"meta,omitempty"`
+	Strategy Strategy `yaml:"strategy,omitempty"`
+
+	// Selector restricts this entry to hosts whose labels match it, using the
+	// boolean DSL parsed by policies.matchLabels (e.g. "env=prod,!maintenance").
+	// An empty Selector applies unconditionally.
+	Selector string `yaml:"selector,omitempty"`
+}
@@ -0,0 +1,293 @@
+package policies
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/ubuntu/adsys/internal/i18n"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultLabelsDir is scanned for extra host labels shipped without going through GPOs.
+const defaultLabelsDir = "/etc/adsys/labels.d"
+
+// LabelDiscoverer probes the local host for a set of labels (e.g. systemd-detect-virt,
+// cloud-init metadata) usable as policy selector targets.
+type LabelDiscoverer interface {
+	Discover() (map[string]string, error)
+}
+
+// SystemdDetectVirtDiscoverer discovers the "virtualization" label by running
+// systemd-detect-virt, so a selector can target e.g. "virtualization=kvm" or
+// "virtualization=none" for bare-metal hosts.
+type SystemdDetectVirtDiscoverer struct{}
+
+// NewSystemdDetectVirtDiscoverer returns a LabelDiscoverer backed by systemd-detect-virt.
+func NewSystemdDetectVirtDiscoverer() *SystemdDetectVirtDiscoverer {
+	return &SystemdDetectVirtDiscoverer{}
+}
+
+// Discover runs systemd-detect-virt and reports its output as the
+// "virtualization" label. systemd-detect-virt exits non-zero when the host
+// is bare metal, still printing "none" to stdout, so that output is used
+// regardless of the command's exit status.
+func (d *SystemdDetectVirtDiscoverer) Discover() (map[string]string, error) {
+	// #nosec G204 - no arguments, fixed command name.
+	out, err := exec.CommandContext(context.Background(), "systemd-detect-virt").Output()
+	virt := strings.TrimSpace(string(out))
+	if virt == "" {
+		if err != nil {
+			return nil, fmt.Errorf(i18n.G("can't run systemd-detect-virt: %v"), err)
+		}
+		return nil, fmt.Errorf(i18n.G("systemd-detect-virt returned no output"))
+	}
+	return map[string]string{"virtualization": virt}, nil
+}
+
+// defaultCloudInitInstanceData is the default location of cloud-init's cached
+// instance metadata document.
+const defaultCloudInitInstanceData = "/run/cloud-init/instance-data.json"
+
+// CloudInitDiscoverer discovers cloud metadata labels (cloud name, region,
+// availability zone) from cloud-init's cached instance data document.
+type CloudInitDiscoverer struct {
+	path string
+}
+
+// NewCloudInitDiscoverer returns a LabelDiscoverer reading cloud-init's
+// instance data from its default location.
+func NewCloudInitDiscoverer() *CloudInitDiscoverer {
+	return &CloudInitDiscoverer{path: defaultCloudInitInstanceData}
+}
+
+// NewCloudInitDiscovererWithPath returns a CloudInitDiscoverer reading
+// instance data from a personalized path, for use in tests.
+func NewCloudInitDiscovererWithPath(p string) *CloudInitDiscoverer {
+	return &CloudInitDiscoverer{path: p}
+}
+
+// cloudInitInstanceData is the subset of cloud-init's instance-data.json we care about.
+type cloudInitInstanceData struct {
+	V1 struct {
+		CloudName        string `json:"cloud_name"`
+		Region           string `json:"region"`
+		AvailabilityZone string `json:"availability_zone"`
+	} `json:"v1"`
+}
+
+// Discover reads and parses cloud-init's instance data document, reporting
+// whichever of "cloud", "region" and "availability-zone" it was able to fill in.
+func (d *CloudInitDiscoverer) Discover() (map[string]string, error) {
+	raw, err := os.ReadFile(d.path)
+	if err != nil {
+		return nil, err
+	}
+	var data cloudInitInstanceData
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, fmt.Errorf(i18n.G("invalid cloud-init instance data %s: %v"), d.path, err)
+	}
+
+	labels := make(map[string]string)
+	if data.V1.CloudName != "" {
+		labels["cloud"] = data.V1.CloudName
+	}
+	if data.V1.Region != "" {
+		labels["region"] = data.V1.Region
+	}
+	if data.V1.AvailabilityZone != "" {
+		labels["availability-zone"] = data.V1.AvailabilityZone
+	}
+	return labels, nil
+}
+
+// WithHostLabels seeds the manager's host labels used to evaluate policy selectors.
+// These take precedence over labels loaded from /etc/adsys/labels.d/*.yaml or from
+// any configured LabelDiscoverer.
+func WithHostLabels(labels map[string]string) Option {
+	return func(o *options) error {
+		o.hostLabels = labels
+		return nil
+	}
+}
+
+// WithLabelDiscoverer adds a pluggable label discoverer probed at manager creation.
+func WithLabelDiscoverer(d LabelDiscoverer) Option {
+	return func(o *options) error {
+		o.labelDiscoverers = append(o.labelDiscoverers, d)
+		return nil
+	}
+}
+
+// loadHostLabels merges labels discovered by discoverers, then those read from
+// /etc/adsys/labels.d/*.yaml, then explicit, each step overriding the previous
+// on key conflict.
+func loadHostLabels(discoverers []LabelDiscoverer, explicit map[string]string) (map[string]string, error) {
+	labels := make(map[string]string)
+
+	for _, d := range discoverers {
+		discovered, err := d.Discover()
+		if err != nil {
+			continue
+		}
+		for k, v := range discovered {
+			labels[k] = v
+		}
+	}
+
+	files, err := filepath.Glob(filepath.Join(defaultLabelsDir, "*.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		d, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		var fileLabels map[string]string
+		if err := yaml.Unmarshal(d, &fileLabels); err != nil {
+			return nil, fmt.Errorf(i18n.G("invalid labels file %s: %v"), f, err)
+		}
+		for k, v := range fileLabels {
+			labels[k] = v
+		}
+	}
+
+	for k, v := range explicit {
+		labels[k] = v
+	}
+
+	return labels, nil
+}
+
+// matchLabels evaluates a boolean selector DSL against labels. A selector is a
+// comma-separated list of requirements, all of which must hold:
+//
+//	key=value          key is set to value
+//	key!=value         key is not set to value
+//	key in (v1,v2)     key is set to one of v1, v2
+//	key notin (v1,v2)  key is not set to any of v1, v2
+//	!key               key is not set
+//
+// A trailing "*" on a value matches as a prefix, e.g. "region in (eu-*)".
+func matchLabels(selector string, labels map[string]string) (bool, error) {
+	selector = strings.TrimSpace(selector)
+	if selector == "" {
+		return true, nil
+	}
+
+	for _, tok := range splitSelector(selector) {
+		ok, err := matchRequirement(strings.TrimSpace(tok), labels)
+		if err != nil {
+			return false, err
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// splitSelector splits a selector on top-level commas, ignoring commas nested
+// inside "in (...)" / "notin (...)" value lists.
+func splitSelector(s string) []string {
+	var parts []string
+	depth := 0
+	start := 0
+	for i, r := range s {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// matchRequirement evaluates a single selector requirement against labels.
+func matchRequirement(tok string, labels map[string]string) (bool, error) {
+	switch {
+	case strings.HasPrefix(tok, "!"):
+		key := strings.TrimSpace(strings.TrimPrefix(tok, "!"))
+		_, exists := labels[key]
+		return !exists, nil
+
+	case strings.Contains(tok, "!="):
+		key, value, _ := strings.Cut(tok, "!=")
+		v, exists := labels[strings.TrimSpace(key)]
+		return !exists || !matchValue(v, strings.TrimSpace(value)), nil
+
+	case strings.Contains(tok, " notin "):
+		key, rest, _ := strings.Cut(tok, " notin ")
+		values, err := parseValueList(rest)
+		if err != nil {
+			return false, err
+		}
+		v, exists := labels[strings.TrimSpace(key)]
+		if !exists {
+			return true, nil
+		}
+		for _, want := range values {
+			if matchValue(v, want) {
+				return false, nil
+			}
+		}
+		return true, nil
+
+	case strings.Contains(tok, " in "):
+		key, rest, _ := strings.Cut(tok, " in ")
+		values, err := parseValueList(rest)
+		if err != nil {
+			return false, err
+		}
+		v, exists := labels[strings.TrimSpace(key)]
+		if !exists {
+			return false, nil
+		}
+		for _, want := range values {
+			if matchValue(v, want) {
+				return true, nil
+			}
+		}
+		return false, nil
+
+	case strings.Contains(tok, "="):
+		key, value, _ := strings.Cut(tok, "=")
+		v, exists := labels[strings.TrimSpace(key)]
+		return exists && matchValue(v, strings.TrimSpace(value)), nil
+	}
+
+	return false, fmt.Errorf(i18n.G("invalid selector requirement %q"), tok)
+}
+
+// parseValueList parses a "(v1,v2,...)" value list as used by "in"/"notin".
+func parseValueList(s string) ([]string, error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "(") || !strings.HasSuffix(s, ")") {
+		return nil, fmt.Errorf(i18n.G("expected a parenthesized value list, got %q"), s)
+	}
+	var values []string
+	for _, v := range strings.Split(s[1:len(s)-1], ",") {
+		values = append(values, strings.TrimSpace(v))
+	}
+	return values, nil
+}
+
+// matchValue compares v against pattern, treating a trailing "*" on pattern as
+// a prefix match.
+func matchValue(v, pattern string) bool {
+	if strings.HasSuffix(pattern, "*") {
+		return strings.HasPrefix(v, strings.TrimSuffix(pattern, "*"))
+	}
+	return v == pattern
+}
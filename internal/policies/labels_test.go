@@ -0,0 +1,144 @@
+package policies
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	_ LabelDiscoverer = (*SystemdDetectVirtDiscoverer)(nil)
+	_ LabelDiscoverer = (*CloudInitDiscoverer)(nil)
+)
+
+func TestMatchLabels(t *testing.T) {
+	t.Parallel()
+
+	labels := map[string]string{"env": "prod", "region": "eu-west-1"}
+
+	tests := map[string]struct {
+		selector string
+		want     bool
+		wantErr  bool
+	}{
+		"empty selector always matches":    {selector: "", want: true},
+		"equality match":                   {selector: "env=prod", want: true},
+		"equality mismatch":                {selector: "env=staging", want: false},
+		"not equal, key set to other":      {selector: "env!=staging", want: true},
+		"not equal, key set to same":       {selector: "env!=prod", want: false},
+		"negation, key unset":              {selector: "!maintenance", want: true},
+		"negation, key set":                {selector: "!env", want: false},
+		"in list match":                    {selector: "env in (prod,staging)", want: true},
+		"in list mismatch":                 {selector: "env in (dev,staging)", want: false},
+		"notin list, key absent":           {selector: "missing notin (a,b)", want: true},
+		"notin list match excludes":        {selector: "env notin (prod,staging)", want: false},
+		"prefix match":                     {selector: "region in (eu-*)", want: true},
+		"prefix mismatch":                  {selector: "region in (us-*)", want: false},
+		"multiple requirements all match":  {selector: "env=prod,region=eu-west-1", want: true},
+		"multiple requirements one fails":  {selector: "env=prod,region=us-east-1", want: false},
+		"invalid requirement":              {selector: "env~prod", wantErr: true},
+		"unterminated value list":          {selector: "env in (prod", wantErr: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := matchLabels(tc.selector, labels)
+			if tc.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestLoadHostLabelsPrecedence(t *testing.T) {
+	t.Parallel()
+
+	discovered := fakeDiscoverer{labels: map[string]string{"virtualization": "kvm", "source": "discoverer"}}
+	explicit := map[string]string{"source": "explicit"}
+
+	got, err := loadHostLabels([]LabelDiscoverer{discovered}, explicit)
+	require.NoError(t, err)
+
+	require.Equal(t, "kvm", got["virtualization"])
+	require.Equal(t, "explicit", got["source"], "explicit labels must win over a discoverer on conflict")
+}
+
+func TestLoadHostLabelsIgnoresFailingDiscoverer(t *testing.T) {
+	t.Parallel()
+
+	ok := fakeDiscoverer{labels: map[string]string{"env": "prod"}}
+
+	got, err := loadHostLabels([]LabelDiscoverer{badDiscoverer{}, ok}, nil)
+	require.NoError(t, err)
+	require.Equal(t, "prod", got["env"])
+}
+
+func TestPoliciesEffectiveLabels(t *testing.T) {
+	t.Parallel()
+
+	pols := Policies{Labels: map[string]string{"ou": "engineering", "env": "stale"}}
+	hostLabels := map[string]string{"env": "prod"}
+
+	got := pols.effectiveLabels(hostLabels)
+	require.Equal(t, "engineering", got["ou"])
+	require.Equal(t, "prod", got["env"], "host-discovered labels must win over stale directory-sourced ones")
+
+	var empty Policies
+	require.Equal(t, hostLabels, empty.effectiveLabels(hostLabels))
+}
+
+func TestCloudInitDiscoverer(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "instance-data.json")
+	data := map[string]any{
+		"v1": map[string]string{
+			"cloud_name":        "aws",
+			"region":            "eu-west-1",
+			"availability_zone": "eu-west-1a",
+		},
+	}
+	raw, err := json.Marshal(data)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, raw, 0600))
+
+	d := NewCloudInitDiscovererWithPath(path)
+	labels, err := d.Discover()
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{
+		"cloud":             "aws",
+		"region":            "eu-west-1",
+		"availability-zone": "eu-west-1a",
+	}, labels)
+}
+
+func TestCloudInitDiscovererMissingFile(t *testing.T) {
+	t.Parallel()
+
+	d := NewCloudInitDiscovererWithPath(filepath.Join(t.TempDir(), "missing.json"))
+	_, err := d.Discover()
+	require.Error(t, err)
+}
+
+type fakeDiscoverer struct {
+	labels map[string]string
+}
+
+func (f fakeDiscoverer) Discover() (map[string]string, error) {
+	return f.labels, nil
+}
+
+type badDiscoverer struct{}
+
+func (badDiscoverer) Discover() (map[string]string, error) {
+	return nil, os.ErrInvalid
+}
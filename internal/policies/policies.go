@@ -2,13 +2,16 @@ package policies
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/godbus/dbus/v5"
@@ -16,10 +19,14 @@ import (
 	"github.com/ubuntu/adsys/internal/decorate"
 	log "github.com/ubuntu/adsys/internal/grpc/logstreamer"
 	"github.com/ubuntu/adsys/internal/i18n"
+	"github.com/ubuntu/adsys/internal/policies/apparmor"
+	"github.com/ubuntu/adsys/internal/policies/audit"
 	"github.com/ubuntu/adsys/internal/policies/dconf"
 	"github.com/ubuntu/adsys/internal/policies/entry"
 	"github.com/ubuntu/adsys/internal/policies/gdm"
 	"github.com/ubuntu/adsys/internal/policies/privilege"
+	"github.com/ubuntu/adsys/internal/policies/scripts"
+	"github.com/ubuntu/adsys/internal/policies/subscription"
 	"golang.org/x/sync/errgroup"
 	"gopkg.in/yaml.v3"
 )
@@ -31,19 +38,33 @@ type Manager struct {
 	dconf     *dconf.Manager
 	privilege *privilege.Manager
 	gdm       *gdm.Manager
+	scripts   *scripts.Manager
+	apparmor  *apparmor.Manager
 
-	subcriptionDbus dbus.BusObject
+	subscriptionProvider subscription.Provider
+	hostLabels           map[string]string
+	auditSink            audit.Sink
 
 	sync.RWMutex
-	subscriptionEnabled bool
+	entitlements map[string]bool
 }
 
+// defaultEntitlementTTL is how long a subscription provider's last-known-good
+// result is trusted before a fresh refresh is attempted.
+const defaultEntitlementTTL = 4 * time.Hour
+
 type options struct {
-	cacheDir     string
-	dconfDir     string
-	sudoersDir   string
-	policyKitDir string
-	gdm          *gdm.Manager
+	cacheDir             string
+	dconfDir             string
+	sudoersDir           string
+	policyKitDir         string
+	scriptsDir           string
+	apparmorDir          string
+	subscriptionProvider subscription.Provider
+	hostLabels           map[string]string
+	labelDiscoverers     []LabelDiscoverer
+	auditSink            audit.Sink
+	gdm                  *gdm.Manager
 }
 
 // Option reprents an optional function to change Policies behavior.
@@ -81,6 +102,40 @@ func WithPolicyKitDir(p string) Option {
 	}
 }
 
+// WithScriptsDir specifies a personalized scripts directory.
+func WithScriptsDir(p string) Option {
+	return func(o *options) error {
+		o.scriptsDir = p
+		return nil
+	}
+}
+
+// WithApparmorDir specifies a personalized apparmor profiles directory.
+func WithApparmorDir(p string) Option {
+	return func(o *options) error {
+		o.apparmorDir = p
+		return nil
+	}
+}
+
+// WithSubscriptionProvider specifies a personalized entitlement backend.
+// Defaults to the Ubuntu Advantage D-Bus backend when not set.
+func WithSubscriptionProvider(p subscription.Provider) Option {
+	return func(o *options) error {
+		o.subscriptionProvider = p
+		return nil
+	}
+}
+
+// WithAuditSink specifies where audit events for policy application decisions
+// are emitted. Defaults to a no-op sink when not set.
+func WithAuditSink(s audit.Sink) Option {
+	return func(o *options) error {
+		o.auditSink = s
+		return nil
+	}
+}
+
 // NewManager returns a new manager with all default policy handlers.
 func NewManager(bus *dbus.Conn, opts ...Option) (m *Manager, err error) {
 	defer decorate.OnError(&err, i18n.G("can't create a new policy handlers manager"))
@@ -105,6 +160,12 @@ func NewManager(bus *dbus.Conn, opts ...Option) (m *Manager, err error) {
 	// privilege manager
 	privilegeManager := privilege.NewWithDirs(args.sudoersDir, args.policyKitDir)
 
+	// scripts manager
+	scriptsManager := scripts.NewWithScriptsDir(args.scriptsDir)
+
+	// apparmor manager
+	apparmorManager := apparmor.NewWithDir(args.apparmorDir)
+
 	// inject applied dconf mangager if we need to build a gdm manager
 	if args.gdm == nil {
 		if args.gdm, err = gdm.New(gdm.WithDconf(dconfManager)); err != nil {
@@ -117,8 +178,22 @@ func NewManager(bus *dbus.Conn, opts ...Option) (m *Manager, err error) {
 		return nil, err
 	}
 
-	subscriptionDbus := bus.Object(consts.SubcriptionDbusRegisteredName,
-		dbus.ObjectPath(consts.SubcriptionDbusObjectPath))
+	// subscription provider, defaulting to the historical Ubuntu Advantage backend
+	subscriptionProvider := args.subscriptionProvider
+	if subscriptionProvider == nil {
+		subscriptionProvider = subscription.NewUbuntuAdvantageProvider(bus)
+	}
+	subscriptionProvider = subscription.NewCachedProvider(subscriptionProvider, defaultEntitlementTTL)
+
+	hostLabels, err := loadHostLabels(args.labelDiscoverers, args.hostLabels)
+	if err != nil {
+		return nil, err
+	}
+
+	auditSink := args.auditSink
+	if auditSink == nil {
+		auditSink = audit.NewMultiSink()
+	}
 
 	return &Manager{
 		policiesCacheDir: policiesCacheDir,
@@ -126,66 +201,466 @@ func NewManager(bus *dbus.Conn, opts ...Option) (m *Manager, err error) {
 		dconf:     dconfManager,
 		privilege: privilegeManager,
 		gdm:       args.gdm,
+		scripts:   scriptsManager,
+		apparmor:  apparmorManager,
 
-		subcriptionDbus: subscriptionDbus,
+		subscriptionProvider: subscriptionProvider,
+		hostLabels:           hostLabels,
+		auditSink:            auditSink,
 	}, nil
 }
 
 // Policies is the list of GPOs applied to a particular object, with the global data cache.
 type Policies struct {
 	GPOs []GPO
-	Data io.ReaderAt `yaml:"-"`
+	// Labels carries directory-sourced labels for the target object (e.g.
+	// hostname, OU, tags, cloud metadata), evaluated against entry selectors
+	// alongside the locally discovered host labels. See effectiveLabels.
+	Labels map[string]string `yaml:"labels,omitempty"`
+	Data   io.ReaderAt       `yaml:"-"`
 }
 
-// NewFromCache returns cached policies loaded from the p json file.
+// effectiveLabels merges pols.Labels with hostLabels for selector evaluation,
+// with hostLabels winning on conflict: a label actually observed on this
+// host should never be shadowed by stale directory-sourced metadata.
+func (pols Policies) effectiveLabels(hostLabels map[string]string) map[string]string {
+	if len(pols.Labels) == 0 {
+		return hostLabels
+	}
+	labels := make(map[string]string, len(pols.Labels)+len(hostLabels))
+	for k, v := range pols.Labels {
+		labels[k] = v
+	}
+	for k, v := range hostLabels {
+		labels[k] = v
+	}
+	return labels
+}
+
+// CurrentSchemaVersion is the cache schema version written by this build. Bump
+// it and register a migration in migrations whenever a change to entry.Entry,
+// GPO or Policies would otherwise silently corrupt or misparse an existing cache.
+const CurrentSchemaVersion = 1
+
+// cacheEnvelope is the on-disk format of a cached Policies payload, wrapping it
+// with enough information to detect and migrate stale schemas.
+type cacheEnvelope struct {
+	SchemaVersion int       `yaml:"schema_version"`
+	WrittenAt     time.Time `yaml:"written_at"`
+	Payload       Policies  `yaml:"payload"`
+}
+
+// migrations maps a schema version to the function upgrading a raw cache file
+// written at that version to the next one. It is consulted in order on load
+// until the raw document reaches CurrentSchemaVersion.
+var migrations = map[int]func(raw []byte) ([]byte, error){
+	0: migrateV0toV1,
+}
+
+// migrateV0toV1 wraps a pre-versioning cache file (a bare Policies document,
+// with no envelope at all) into a v1 envelope.
+func migrateV0toV1(raw []byte) ([]byte, error) {
+	var pols Policies
+	if err := yaml.Unmarshal(raw, &pols); err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(cacheEnvelope{
+		SchemaVersion: 1,
+		WrittenAt:     time.Now(),
+		Payload:       pols,
+	})
+}
+
+// migrateToCurrentSchema runs raw through the registered migrations until it
+// reaches CurrentSchemaVersion, returning the up-to-date document.
+func migrateToCurrentSchema(raw []byte) ([]byte, error) {
+	var probe struct {
+		SchemaVersion int `yaml:"schema_version"`
+	}
+	if err := yaml.Unmarshal(raw, &probe); err != nil {
+		return nil, err
+	}
+
+	if probe.SchemaVersion > CurrentSchemaVersion {
+		return nil, fmt.Errorf(i18n.G("cache was written by a newer version of adsys (schema version %d, this build only understands up to %d)"), probe.SchemaVersion, CurrentSchemaVersion)
+	}
+
+	for probe.SchemaVersion < CurrentSchemaVersion {
+		migrate, ok := migrations[probe.SchemaVersion]
+		if !ok {
+			return nil, fmt.Errorf(i18n.G("no migration registered from schema version %d"), probe.SchemaVersion)
+		}
+		var err error
+		if raw, err = migrate(raw); err != nil {
+			return nil, err
+		}
+		if err := yaml.Unmarshal(raw, &probe); err != nil {
+			return nil, err
+		}
+	}
+
+	return raw, nil
+}
+
+// marshalCacheEnvelope wraps pols in a cacheEnvelope at CurrentSchemaVersion.
+func marshalCacheEnvelope(pols Policies) ([]byte, error) {
+	return yaml.Marshal(cacheEnvelope{
+		SchemaVersion: CurrentSchemaVersion,
+		WrittenAt:     time.Now(),
+		Payload:       pols,
+	})
+}
+
+// lockCache takes an advisory lock on a sentinel file next to p (shared for
+// reads, exclusive for writes), so a concurrent ApplyPolicies can't race with
+// DumpPolicies over a half-written cache file. The caller must call the
+// returned unlock once done.
+func lockCache(p string, exclusive bool) (unlock func() error, err error) {
+	f, err := os.OpenFile(p+".lock", os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	how := syscall.LOCK_SH
+	if exclusive {
+		how = syscall.LOCK_EX
+	}
+	if err := syscall.Flock(int(f.Fd()), how); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+
+	return func() error {
+		defer f.Close()
+		return syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+	}, nil
+}
+
+// NewFromCache returns cached policies loaded from the p file, migrating it to
+// CurrentSchemaVersion on the fly if it was written by an older version.
 func NewFromCache(p string) (pols Policies, err error) {
 	defer decorate.OnError(&err, i18n.G("can't get cached policies from %s"), p)
 
+	unlock, err := lockCache(p, false)
+	if err != nil {
+		return pols, err
+	}
+	defer unlock()
+
 	d, err := os.ReadFile(p)
 	if err != nil {
 		return pols, err
 	}
 
-	if err := yaml.Unmarshal(d, &pols); err != nil {
+	d, err = migrateToCurrentSchema(d)
+	if err != nil {
+		return pols, err
+	}
+
+	var env cacheEnvelope
+	if err := yaml.Unmarshal(d, &env); err != nil {
 		return pols, err
 	}
-	return pols, nil
+	return env.Payload, nil
+}
+
+// Verify checks that the cache file at path parses and migrates cleanly to
+// CurrentSchemaVersion, without writing anything back to disk.
+//
+// Verify is the library-level primitive an "adsysctl policy verify" command
+// would call per host to surface schema/version drift across a fleet; that
+// adsysctl subcommand lives in cmd/adsysctl, which this change does not
+// touch, and still needs to be added before Verify is reachable from the CLI.
+func Verify(path string) (err error) {
+	defer decorate.OnError(&err, i18n.G("can't verify cache file %s"), path)
+
+	_, err = NewFromCache(path)
+	return err
 }
 
-// Save serializes in p the policies.
+// Save serializes in p the policies, atomically and under an exclusive lock.
 func (pols *Policies) Save(p string) (err error) {
 	defer decorate.OnError(&err, i18n.G("can't save policies to %s"), p)
 
-	d, err := yaml.Marshal(pols)
+	d, err := marshalCacheEnvelope(*pols)
+	if err != nil {
+		return err
+	}
+
+	unlock, err := lockCache(p, true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return atomicWriteFile(p, d)
+}
+
+// PutPolicies validates pols and atomically persists them as the cached policies
+// for objectName, without applying them to the system. This allows an operator
+// to stage a policy ahead of the next GPO refresh.
+//
+// PutPolicies, DeletePolicies and SimulateApply take and return plain
+// arguments (no streaming state) precisely so a gRPC handler can wrap them
+// directly; that handler and the matching adsysctl "policy put/delete/
+// simulate" subcommand live in cmd/adsysd and cmd/adsysctl, which this
+// change does not touch: the CLI/gRPC surface still needs to be added there
+// before these are reachable from outside the package.
+func (m *Manager) PutPolicies(ctx context.Context, objectName string, pols Policies) (err error) {
+	defer decorate.OnError(&err, i18n.G("can't put policies for %q"), objectName)
+
+	log.Debugf(ctx, "Putting policies for %s", objectName)
+
+	if err := pols.validate(); err != nil {
+		return err
+	}
+
+	d, err := marshalCacheEnvelope(pols)
 	if err != nil {
 		return err
 	}
-	if err := os.WriteFile(p, d, 0600); err != nil {
+
+	p := filepath.Join(m.policiesCacheDir, objectName)
+	unlock, err := lockCache(p, true)
+	if err != nil {
 		return err
 	}
+	defer unlock()
 
+	return atomicWriteFile(p, d)
+}
+
+// validate reports the first malformed GPO, entry strategy, selector or
+// script key found in pols, so PutPolicies can reject a bad payload before it
+// ever reaches the cache an eventual ApplyPolicies run would read back.
+func (pols Policies) validate() error {
+	for _, gpo := range pols.GPOs {
+		if gpo.ID == "" {
+			return errors.New(i18n.G("a GPO is missing its id"))
+		}
+		for t, entries := range gpo.Rules {
+			for _, e := range entries {
+				if e.Key == "" {
+					return fmt.Errorf(i18n.G("GPO %q has an empty key for rule type %q"), gpo.ID, t)
+				}
+				switch e.Strategy {
+				case "", entry.StrategyOverride, entry.StrategyAppend:
+				default:
+					return fmt.Errorf(i18n.G("GPO %q key %q has unknown strategy %q"), gpo.ID, e.Key, e.Strategy)
+				}
+				if selector := strings.TrimSpace(e.Selector); selector != "" {
+					// Check every requirement: matchLabels stops at the first one
+					// that doesn't match, which would hide a malformed later one.
+					for _, tok := range splitSelector(selector) {
+						if _, err := matchRequirement(strings.TrimSpace(tok), nil); err != nil {
+							return fmt.Errorf(i18n.G("GPO %q key %q has an invalid selector: %v"), gpo.ID, e.Key, err)
+						}
+					}
+				}
+				if t == "script" {
+					if err := scripts.ValidateKey(e.Key); err != nil {
+						return fmt.Errorf(i18n.G("GPO %q has an invalid script entry: %v"), gpo.ID, err)
+					}
+				}
+				if t == "apparmor" {
+					if err := apparmor.ValidateKey(e.Key); err != nil {
+						return fmt.Errorf(i18n.G("GPO %q has an invalid apparmor entry: %v"), gpo.ID, err)
+					}
+				}
+			}
+		}
+	}
 	return nil
 }
 
+// DeletePolicies removes any cached policies for objectName.
+func (m *Manager) DeletePolicies(ctx context.Context, objectName string) (err error) {
+	defer decorate.OnError(&err, i18n.G("can't delete policies for %q"), objectName)
+
+	log.Debugf(ctx, "Deleting policies for %s", objectName)
+
+	p := filepath.Join(m.policiesCacheDir, objectName)
+	unlock, err := lockCache(p, true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// SimulateApply computes which dconf/privilege/gdm/script/apparmor keys would
+// change if pols were applied to objectName, without touching the system or
+// the policies cache.
+func (m *Manager) SimulateApply(ctx context.Context, objectName string, isComputer bool, pols Policies) (diff string, err error) {
+	defer decorate.OnError(&err, i18n.G("can't simulate policy application for %q"), objectName)
+
+	log.Debugf(ctx, "Simulating policy application for %s (machine: %v)", objectName, isComputer)
+
+	current, err := NewFromCache(filepath.Join(m.policiesCacheDir, objectName))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+
+	// Simulations never hit the configured audit sink: nothing is actually applied.
+	noopSink := audit.NewMultiSink()
+	currentRules := current.GetUniqueRules(ctx, objectName, isComputer, current.effectiveLabels(m.hostLabels), nil, noopSink)
+	// newRules' events report currentRules' values as PriorValue, since that's
+	// what's actually cached right now.
+	priorValues := priorValuesIndex(currentRules)
+	newRules := pols.GetUniqueRules(ctx, objectName, isComputer, pols.effectiveLabels(m.hostLabels), priorValues, noopSink)
+
+	// Apply the same Pro entitlement filtering ApplyPolicies would, so the
+	// simulated diff doesn't report Pro-gated keys as changing on a host that
+	// isn't entitled to them.
+	entitlements := m.refreshEntitlements(ctx)
+	filterRules(ctx, objectName, isComputer, currentRules, entitlements, nil, noopSink)
+	filterRules(ctx, objectName, isComputer, newRules, entitlements, priorValues, noopSink)
+
+	var out strings.Builder
+	for _, t := range sortedRuleTypes(currentRules, newRules) {
+		diffRuleType(&out, t, currentRules[t], newRules[t])
+	}
+
+	return out.String(), nil
+}
+
+// atomicWriteFile writes d to a temporary file next to p and renames it into
+// place, so a reader never observes a partially written file.
+func atomicWriteFile(p string, d []byte) error {
+	tmp := p + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(d); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p)
+}
+
+// sortedRuleTypes returns the sorted union of rule type keys across rule maps.
+func sortedRuleTypes(rules ...map[string][]entry.Entry) []string {
+	seen := make(map[string]struct{})
+	var types []string
+	for _, r := range rules {
+		for t := range r {
+			if _, ok := seen[t]; ok {
+				continue
+			}
+			seen[t] = struct{}{}
+			types = append(types, t)
+		}
+	}
+	sort.Strings(types)
+	return types
+}
+
+// diffRuleType writes to out one line per key of type t whose entry was added,
+// removed or changed between before and after.
+func diffRuleType(out *strings.Builder, t string, before, after []entry.Entry) {
+	beforeByKey := make(map[string]entry.Entry, len(before))
+	for _, e := range before {
+		beforeByKey[e.Key] = e
+	}
+	afterByKey := make(map[string]entry.Entry, len(after))
+	for _, e := range after {
+		afterByKey[e.Key] = e
+	}
+
+	seen := make(map[string]struct{})
+	var keys []string
+	for _, e := range append(before, after...) {
+		if _, ok := seen[e.Key]; ok {
+			continue
+		}
+		seen[e.Key] = struct{}{}
+		keys = append(keys, e.Key)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		b, hasBefore := beforeByKey[k]
+		a, hasAfter := afterByKey[k]
+		switch {
+		case !hasBefore:
+			fmt.Fprintf(out, "+ %s/%s: %s\n", t, k, a.Value)
+		case !hasAfter:
+			fmt.Fprintf(out, "- %s/%s: %s\n", t, k, b.Value)
+		case b.Value != a.Value:
+			fmt.Fprintf(out, "~ %s/%s: %s -> %s\n", t, k, b.Value, a.Value)
+		}
+	}
+}
+
 // GetUniqueRules return order rules, with one entry per key for a given type.
+// Entries whose Selector does not match labels are dropped before dedup, so a
+// targeted GPO entry that doesn't apply to this host never shadows a more
+// general one. Every applied, skipped or overridden entry is reported to sink,
+// so the decision can be reconstructed later even if it wasn't applied. prior,
+// if non-nil, is a type -> key -> value index (see priorValuesIndex) used to
+// populate each event's PriorValue with the value that key held before this run.
 // Returned file is a map of type to its entries.
-func (pols Policies) GetUniqueRules() map[string][]entry.Entry {
+func (pols Policies) GetUniqueRules(ctx context.Context, objectName string, isComputer bool, labels map[string]string, prior map[string]map[string]string, sink audit.Sink) map[string][]entry.Entry {
 	r := make(map[string][]entry.Entry)
 	keys := make(map[string][]string)
 
+	emit := func(gpoID, ruleType string, e entry.Entry, applied bool, reason string) {
+		_ = sink.EmitApply(ctx, audit.Event{
+			Timestamp:      time.Now(),
+			ObjectName:     objectName,
+			IsComputer:     isComputer,
+			GPOID:          gpoID,
+			RuleType:       ruleType,
+			Key:            e.Key,
+			PriorValue:     prior[ruleType][e.Key],
+			NewValue:       e.Value,
+			Strategy:       string(e.Strategy),
+			Applied:        applied,
+			OverrideReason: reason,
+		})
+	}
+
 	// Dedup entries, first GPO wins for a given type + key
 	dedup := make(map[string]map[string]entry.Entry)
+	// gpoIDs tracks, for each type + key, the id of the GPO that produced the
+	// value currently winning in dedup, so the final audit event for that key
+	// can be attributed to it.
+	gpoIDs := make(map[string]map[string]string)
 	seen := make(map[string]struct{})
 	for _, gpo := range pols.GPOs {
 		for t, entries := range gpo.Rules {
 			if dedup[t] == nil {
 				dedup[t] = make(map[string]entry.Entry)
 			}
+			if gpoIDs[t] == nil {
+				gpoIDs[t] = make(map[string]string)
+			}
 			for _, e := range entries {
+				if e.Selector != "" {
+					match, err := matchLabels(e.Selector, labels)
+					if err != nil || !match {
+						emit(gpo.ID, t, e, false, audit.ReasonSelectorMismatch)
+						continue
+					}
+				}
+
 				switch e.Strategy {
 				case entry.StrategyAppend:
 					// We skip disabled keys as we only append enabled one.
 					if e.Disabled {
+						emit(gpo.ID, t, e, false, audit.ReasonDisabled)
 						continue
 					}
 					var keyAlreadySeen bool
@@ -194,13 +669,20 @@ func (pols Policies) GetUniqueRules() map[string][]entry.Entry {
 						keyAlreadySeen = true
 						// We have seen a closest key which is an override. We don’t append furthest append values.
 						if dedup[t][e.Key].Strategy != entry.StrategyAppend {
+							emit(gpo.ID, t, e, false, audit.ReasonOverriddenByCloserGPO)
 							continue
 						}
 						e.Value = e.Value + "\n" + dedup[t][e.Key].Value
 						// Keep closest meta value.
 						e.Meta = dedup[t][e.Key].Meta
+						// This GPO's contribution is folded into the chain here; the
+						// final summary loop emits the single Applied: true event
+						// once the chain is fully merged, so report this as not yet
+						// applied to keep one "applied" event per key.
+						emit(gpo.ID, t, e, false, audit.ReasonAppendMerged)
 					}
 					dedup[t][e.Key] = e
+					gpoIDs[t][e.Key] = gpo.ID
 					if keyAlreadySeen {
 						continue
 					}
@@ -208,9 +690,11 @@ func (pols Policies) GetUniqueRules() map[string][]entry.Entry {
 				default:
 					// override case
 					if _, exists := seen[t+e.Key]; exists {
+						emit(gpo.ID, t, e, false, audit.ReasonOverriddenByCloserGPO)
 						continue
 					}
 					dedup[t][e.Key] = e
+					gpoIDs[t][e.Key] = gpo.ID
 				}
 
 				keys[t] = append(keys[t], e.Key)
@@ -225,6 +709,7 @@ func (pols Policies) GetUniqueRules() map[string][]entry.Entry {
 		sort.Strings(keys[t])
 		for _, k := range keys[t] {
 			entries = append(entries, dedup[t][k])
+			emit(gpoIDs[t][k], t, dedup[t][k], true, "")
 		}
 		r[t] = entries
 	}
@@ -239,17 +724,24 @@ func (m *Manager) ApplyPolicies(ctx context.Context, objectName string, isComput
 
 	log.Infof(ctx, "Apply policy for %s (machine: %v)", objectName, isComputer)
 
-	rules := pols.GetUniqueRules()
+	// Best-effort: load whatever was cached from the previous apply so emitted
+	// audit events can report each key's PriorValue. A missing or unreadable
+	// cache (first apply, corruption) just means no prior value is known.
+	var priorRules map[string][]entry.Entry
+	if prior, err := NewFromCache(filepath.Join(m.policiesCacheDir, objectName)); err == nil {
+		priorRules = prior.GetUniqueRules(ctx, objectName, isComputer, prior.effectiveLabels(m.hostLabels), nil, audit.NewMultiSink())
+	}
+	priorValues := priorValuesIndex(priorRules)
+
+	rules := pols.GetUniqueRules(ctx, objectName, isComputer, pols.effectiveLabels(m.hostLabels), priorValues, m.auditSink)
 	var g errgroup.Group
 	g.Go(func() error { return m.dconf.ApplyPolicy(ctx, objectName, isComputer, rules["dconf"]) })
 
-	if !m.getSubcriptionState(ctx) {
-		filterRules(ctx, rules)
-	}
+	filterRules(ctx, objectName, isComputer, rules, m.refreshEntitlements(ctx), priorValues, m.auditSink)
 
 	g.Go(func() error { return m.privilege.ApplyPolicy(ctx, objectName, isComputer, rules["privilege"]) })
-	// TODO g.Go(func() error { return m.scripts.ApplyPolicy(ctx, objectName, isComputer, rules["script"]) })
-	// TODO g.Go(func() error { return m.apparmor.ApplyPolicy(ctx, objectName, isComputer, rules["apparmor"]) })
+	g.Go(func() error { return m.scripts.ApplyPolicy(ctx, objectName, isComputer, rules["script"]) })
+	g.Go(func() error { return m.apparmor.ApplyPolicy(ctx, objectName, isComputer, rules["apparmor"]) })
 	if err := g.Wait(); err != nil {
 		return err
 	}
@@ -265,6 +757,21 @@ func (m *Manager) ApplyPolicies(ctx context.Context, objectName string, isComput
 	return pols.Save(filepath.Join(m.policiesCacheDir, objectName))
 }
 
+// RunScripts executes, in order, the scripts materialized for objectName at
+// event. It is the entry point a systemd unit or PAM session hook is expected
+// to call at the matching lifecycle point (session start/end, machine
+// boot/shutdown); adsys itself never calls this from ApplyPolicies, since
+// ApplyPolicies can run on a periodic refresh well outside of that lifecycle.
+//
+// No such unit, timer or PAM hook exists yet: that packaging (outside
+// internal/policies, e.g. under debian/ or a systemd units directory) still
+// needs to be added before scripts materialized on disk actually get run.
+func (m *Manager) RunScripts(ctx context.Context, objectName string, event scripts.Event) (err error) {
+	defer decorate.OnError(&err, i18n.G("failed to run %q scripts for %q"), event, objectName)
+
+	return m.scripts.RunScripts(ctx, objectName, event)
+}
+
 // DumpPolicies displays the currently applied policies and rules (since last update) for objectName.
 // It can in addition show the rules and overridden content.
 func (m *Manager) DumpPolicies(ctx context.Context, objectName string, withRules bool, withOverridden bool) (msg string, err error) {
@@ -327,53 +834,80 @@ func (m *Manager) LastUpdateFor(ctx context.Context, objectName string, isMachin
 	return info.ModTime(), nil
 }
 
-// getSubcriptionState refresh subscription status from Ubuntu Advantage and return it.
-func (m *Manager) getSubcriptionState(ctx context.Context) (subscriptionEnabled bool) {
-	log.Debug(ctx, "Refresh subscription state")
+// refreshEntitlements refreshes the per-feature entitlement map from the
+// configured subscription provider and returns it.
+func (m *Manager) refreshEntitlements(ctx context.Context) (entitlements map[string]bool) {
+	log.Debug(ctx, "Refresh subscription entitlements")
 
 	defer func() {
 		m.Lock()
-		m.subscriptionEnabled = subscriptionEnabled
+		m.entitlements = entitlements
 		m.Unlock()
-
-		if subscriptionEnabled {
-			log.Debug(ctx, "Ubuntu advantage is enabled for GPO restrictions")
-			return
-		}
-
-		log.Debug(ctx, "Ubuntu advantage is not enabled for GPO restrictions")
 	}()
 
-	// Check if the device is entitled to the Pro policy
-	prop, err := m.subcriptionDbus.GetProperty(consts.SubcriptionDbusInterface + ".Status")
+	entitlements, err := m.subscriptionProvider.Entitlements(ctx)
 	if err != nil {
-		log.Warningf(ctx, "no dbus connection to Ubuntu Advantage. Considering device as not enabled: %v", err)
-		return false
-	}
-	enabled, ok := prop.Value().(string)
-	if !ok {
-		log.Warningf(ctx, "dbus returned an improper value from Ubuntu Advantage. Considering device as not enabled: %v", prop.Value())
-		return false
-	}
-
-	if enabled != "enabled" {
-		return false
+		log.Warningf(ctx, "can't get entitlements. Considering device as not entitled to any Pro feature: %v", err)
+		return nil
 	}
 
-	return true
+	return entitlements
 }
 
-// filterRules allow to filter any rules that is not eligible for the current device.
-func filterRules(ctx context.Context, rules map[string][]entry.Entry) {
+// filterRules filters out any Pro-gated rule type the current device is not
+// entitled to, reporting every dropped entry to sink. prior, if non-nil, is a
+// type -> key -> value index (see priorValuesIndex) used to populate each
+// event's PriorValue.
+func filterRules(ctx context.Context, objectName string, isComputer bool, rules map[string][]entry.Entry, entitlements map[string]bool, prior map[string]map[string]string, sink audit.Sink) {
 	log.Debug(ctx, "Filtering Rules")
 
-	rules["privilege"] = nil
-	//rules["script"] = nil
+	filter := func(feature, ruleType string) {
+		if entitlements[feature] {
+			return
+		}
+		for _, e := range rules[ruleType] {
+			_ = sink.EmitApply(ctx, audit.Event{
+				Timestamp:      time.Now(),
+				ObjectName:     objectName,
+				IsComputer:     isComputer,
+				RuleType:       ruleType,
+				Key:            e.Key,
+				PriorValue:     prior[ruleType][e.Key],
+				NewValue:       e.Value,
+				Strategy:       string(e.Strategy),
+				Applied:        false,
+				OverrideReason: audit.ReasonFilteredBySubscription,
+			})
+		}
+		rules[ruleType] = nil
+	}
+
+	filter("privilege", "privilege")
+	filter("scripts", "script")
+	filter("apparmor", "apparmor")
+}
+
+// priorValuesIndex flattens rules into a type -> key -> value lookup, feeding
+// GetUniqueRules' prior argument so its emitted events can report each key's
+// PriorValue even though rules itself is about to be superseded.
+func priorValuesIndex(rules map[string][]entry.Entry) map[string]map[string]string {
+	if rules == nil {
+		return nil
+	}
+	idx := make(map[string]map[string]string, len(rules))
+	for t, entries := range rules {
+		byKey := make(map[string]string, len(entries))
+		for _, e := range entries {
+			byKey[e.Key] = e.Value
+		}
+		idx[t] = byKey
+	}
+	return idx
 }
 
 // GetStatus returns dynamic part of our manager instance like subscription status.
 func (m *Manager) GetStatus() (subscriptionEnabled bool) {
 	m.RLock()
 	defer m.RUnlock()
-	return m.subscriptionEnabled
+	return m.entitlements["privilege"]
 }
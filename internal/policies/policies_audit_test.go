@@ -0,0 +1,158 @@
+package policies
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/ubuntu/adsys/internal/policies/audit"
+	"github.com/ubuntu/adsys/internal/policies/entry"
+)
+
+type recordingSink struct {
+	events []audit.Event
+}
+
+func (s *recordingSink) EmitApply(ctx context.Context, event audit.Event) error {
+	s.events = append(s.events, event)
+	return nil
+}
+
+func (s *recordingSink) byKey(key string) *audit.Event {
+	for i := range s.events {
+		if s.events[i].Key == key && s.events[i].Applied {
+			return &s.events[i]
+		}
+	}
+	return nil
+}
+
+func (s *recordingSink) appliedEvents(key string) []audit.Event {
+	var events []audit.Event
+	for _, e := range s.events {
+		if e.Key == key && e.Applied {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+func TestGetUniqueRulesAttributesWinningGPO(t *testing.T) {
+	t.Parallel()
+
+	pols := Policies{GPOs: []GPO{
+		{ID: "closest", Rules: map[string][]entry.Entry{
+			"dconf": {{Key: "k", Value: "closest-value"}},
+		}},
+		{ID: "furthest", Rules: map[string][]entry.Entry{
+			"dconf": {{Key: "k", Value: "furthest-value"}},
+		}},
+	}}
+
+	sink := &recordingSink{}
+	rules := pols.GetUniqueRules(context.Background(), "host1", true, nil, nil, sink)
+
+	require.Len(t, rules["dconf"], 1)
+	require.Equal(t, "closest-value", rules["dconf"][0].Value)
+
+	applied := sink.byKey("k")
+	require.NotNil(t, applied)
+	require.Equal(t, "closest", applied.GPOID, "the applied event must attribute the GPO that actually won, not the last one processed")
+
+	overridden := sink.events[0]
+	require.Equal(t, "furthest", overridden.GPOID)
+	require.False(t, overridden.Applied)
+	require.Equal(t, audit.ReasonOverriddenByCloserGPO, overridden.OverrideReason)
+}
+
+func TestGetUniqueRulesPopulatesPriorValue(t *testing.T) {
+	t.Parallel()
+
+	pols := Policies{GPOs: []GPO{
+		{ID: "gpo1", Rules: map[string][]entry.Entry{
+			"dconf": {{Key: "k", Value: "new-value"}},
+		}},
+	}}
+
+	prior := map[string]map[string]string{"dconf": {"k": "old-value"}}
+	sink := &recordingSink{}
+	pols.GetUniqueRules(context.Background(), "host1", true, nil, prior, sink)
+
+	applied := sink.byKey("k")
+	require.NotNil(t, applied)
+	require.Equal(t, "old-value", applied.PriorValue)
+	require.Equal(t, "new-value", applied.NewValue)
+}
+
+func TestGetUniqueRulesAppendChainEmitsExactlyOneAppliedEvent(t *testing.T) {
+	t.Parallel()
+
+	pols := Policies{GPOs: []GPO{
+		{ID: "gpoA", Rules: map[string][]entry.Entry{
+			"dconf": {{Key: "k", Value: "A", Strategy: entry.StrategyAppend, Meta: "meta-A"}},
+		}},
+		{ID: "gpoB", Rules: map[string][]entry.Entry{
+			"dconf": {{Key: "k", Value: "B", Strategy: entry.StrategyAppend}},
+		}},
+		{ID: "gpoC", Rules: map[string][]entry.Entry{
+			"dconf": {{Key: "k", Value: "C", Strategy: entry.StrategyAppend}},
+		}},
+	}}
+
+	sink := &recordingSink{}
+	rules := pols.GetUniqueRules(context.Background(), "host1", true, nil, nil, sink)
+
+	require.Len(t, rules["dconf"], 1)
+	require.Equal(t, "C\nB\nA", rules["dconf"][0].Value)
+	require.Equal(t, "meta-A", rules["dconf"][0].Meta, "the closest GPO's meta must survive the whole merge chain")
+
+	applied := sink.appliedEvents("k")
+	require.Len(t, applied, 1, "an append chain must produce exactly one Applied: true event per key")
+	require.Equal(t, "C\nB\nA", applied[0].NewValue)
+
+	var mergeEvents []audit.Event
+	for _, e := range sink.events {
+		if e.OverrideReason == audit.ReasonAppendMerged {
+			mergeEvents = append(mergeEvents, e)
+		}
+	}
+	require.Len(t, mergeEvents, 2, "gpoB and gpoC each fold their contribution into the chain")
+	for _, e := range mergeEvents {
+		require.False(t, e.Applied, "a mid-chain append-merge contribution was never applied on its own")
+	}
+}
+
+func TestGetUniqueRulesSkipsDisabledAppendEntryWithAudit(t *testing.T) {
+	t.Parallel()
+
+	pols := Policies{GPOs: []GPO{
+		{ID: "gpo1", Rules: map[string][]entry.Entry{
+			"dconf": {{Key: "k", Value: "v", Strategy: entry.StrategyAppend, Disabled: true}},
+		}},
+	}}
+
+	sink := &recordingSink{}
+	rules := pols.GetUniqueRules(context.Background(), "host1", true, nil, nil, sink)
+
+	require.Empty(t, rules["dconf"])
+	require.Len(t, sink.events, 1)
+	require.False(t, sink.events[0].Applied)
+	require.Equal(t, audit.ReasonDisabled, sink.events[0].OverrideReason)
+}
+
+func TestGetUniqueRulesDropsSelectorMismatch(t *testing.T) {
+	t.Parallel()
+
+	pols := Policies{GPOs: []GPO{
+		{ID: "gpo1", Rules: map[string][]entry.Entry{
+			"dconf": {{Key: "k", Value: "v", Selector: "env=prod"}},
+		}},
+	}}
+
+	sink := &recordingSink{}
+	rules := pols.GetUniqueRules(context.Background(), "host1", true, map[string]string{"env": "staging"}, nil, sink)
+
+	require.Empty(t, rules["dconf"])
+	require.Len(t, sink.events, 1)
+	require.Equal(t, audit.ReasonSelectorMismatch, sink.events[0].OverrideReason)
+}
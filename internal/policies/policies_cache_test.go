@@ -0,0 +1,76 @@
+package policies
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestSaveAndNewFromCacheRoundtrip(t *testing.T) {
+	t.Parallel()
+
+	pols := Policies{GPOs: []GPO{{ID: "gpo1"}}}
+	p := filepath.Join(t.TempDir(), "myhost")
+
+	require.NoError(t, pols.Save(p))
+
+	got, err := NewFromCache(p)
+	require.NoError(t, err)
+	require.Equal(t, pols.GPOs, got.GPOs)
+
+	require.NoError(t, Verify(p))
+}
+
+func TestMigrateV0ToV1WrapsBareDocument(t *testing.T) {
+	t.Parallel()
+
+	bare, err := yaml.Marshal(Policies{GPOs: []GPO{{ID: "gpo1"}}})
+	require.NoError(t, err)
+
+	migrated, err := migrateV0toV1(bare)
+	require.NoError(t, err)
+
+	var env cacheEnvelope
+	require.NoError(t, yaml.Unmarshal(migrated, &env))
+	require.Equal(t, 1, env.SchemaVersion)
+	require.Equal(t, "gpo1", env.Payload.GPOs[0].ID)
+}
+
+func TestMigrateToCurrentSchemaRejectsNewerVersion(t *testing.T) {
+	t.Parallel()
+
+	raw, err := yaml.Marshal(cacheEnvelope{SchemaVersion: CurrentSchemaVersion + 1})
+	require.NoError(t, err)
+
+	_, err = migrateToCurrentSchema(raw)
+	require.Error(t, err)
+}
+
+func TestMigrateToCurrentSchemaUpgradesBareV0Document(t *testing.T) {
+	t.Parallel()
+
+	bare, err := yaml.Marshal(Policies{GPOs: []GPO{{ID: "gpo1"}}})
+	require.NoError(t, err)
+
+	migrated, err := migrateToCurrentSchema(bare)
+	require.NoError(t, err)
+
+	var env cacheEnvelope
+	require.NoError(t, yaml.Unmarshal(migrated, &env))
+	require.Equal(t, CurrentSchemaVersion, env.SchemaVersion)
+}
+
+func TestVerifyRejectsCacheFromNewerSchema(t *testing.T) {
+	t.Parallel()
+
+	raw, err := yaml.Marshal(cacheEnvelope{SchemaVersion: CurrentSchemaVersion + 1})
+	require.NoError(t, err)
+
+	p := filepath.Join(t.TempDir(), "myhost")
+	require.NoError(t, os.WriteFile(p, raw, 0600))
+
+	require.Error(t, Verify(p))
+}
@@ -0,0 +1,181 @@
+package policies
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/ubuntu/adsys/internal/policies/entry"
+)
+
+func TestPoliciesValidate(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		pols    Policies
+		wantErr bool
+	}{
+		"valid policies": {
+			pols: Policies{GPOs: []GPO{{ID: "gpo1", Rules: map[string][]entry.Entry{
+				"script":   {{Key: "logon/10-greeting", Value: "#!/bin/sh\n"}},
+				"apparmor": {{Key: "my-profile", Value: "profile"}},
+			}}}},
+		},
+		"missing gpo id": {
+			pols:    Policies{GPOs: []GPO{{ID: ""}}},
+			wantErr: true,
+		},
+		"empty key": {
+			pols: Policies{GPOs: []GPO{{ID: "gpo1", Rules: map[string][]entry.Entry{
+				"dconf": {{Key: "", Value: "x"}},
+			}}}},
+			wantErr: true,
+		},
+		"unknown strategy": {
+			pols: Policies{GPOs: []GPO{{ID: "gpo1", Rules: map[string][]entry.Entry{
+				"dconf": {{Key: "k", Value: "v", Strategy: "bogus"}},
+			}}}},
+			wantErr: true,
+		},
+		"invalid selector": {
+			pols: Policies{GPOs: []GPO{{ID: "gpo1", Rules: map[string][]entry.Entry{
+				"dconf": {{Key: "k", Value: "v", Selector: "env~prod"}},
+			}}}},
+			wantErr: true,
+		},
+		"invalid script key": {
+			pols: Policies{GPOs: []GPO{{ID: "gpo1", Rules: map[string][]entry.Entry{
+				"script": {{Key: "logon/1-../../etc/cron.d/evil", Value: "x"}},
+			}}}},
+			wantErr: true,
+		},
+		"invalid apparmor key": {
+			pols: Policies{GPOs: []GPO{{ID: "gpo1", Rules: map[string][]entry.Entry{
+				"apparmor": {{Key: "../../etc/cron.d/evil", Value: "x"}},
+			}}}},
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			err := tc.pols.validate()
+			if tc.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestPutPoliciesRejectsInvalidPayload(t *testing.T) {
+	t.Parallel()
+
+	m := &Manager{policiesCacheDir: t.TempDir()}
+
+	invalid := Policies{GPOs: []GPO{{ID: "gpo1", Rules: map[string][]entry.Entry{
+		"apparmor": {{Key: "../../etc/cron.d/evil", Value: "x"}},
+	}}}}
+
+	err := m.PutPolicies(context.Background(), "myhost", invalid)
+	require.Error(t, err)
+
+	_, err = os.Stat(filepath.Join(m.policiesCacheDir, "myhost"))
+	require.True(t, os.IsNotExist(err), "an invalid payload must never be written to the cache")
+}
+
+func TestPutPoliciesThenDeletePolicies(t *testing.T) {
+	t.Parallel()
+
+	m := &Manager{policiesCacheDir: t.TempDir()}
+
+	valid := Policies{GPOs: []GPO{{ID: "gpo1", Rules: map[string][]entry.Entry{
+		"dconf": {{Key: "k", Value: "v"}},
+	}}}}
+
+	require.NoError(t, m.PutPolicies(context.Background(), "myhost", valid))
+
+	p := filepath.Join(m.policiesCacheDir, "myhost")
+	_, err := os.Stat(p)
+	require.NoError(t, err, "PutPolicies should have written the cache file")
+
+	got, err := NewFromCache(p)
+	require.NoError(t, err)
+	require.Equal(t, valid.GPOs, got.GPOs)
+
+	require.NoError(t, m.DeletePolicies(context.Background(), "myhost"))
+	_, err = os.Stat(p)
+	require.True(t, os.IsNotExist(err), "DeletePolicies should have removed the cache file")
+
+	// Deleting an already-absent cache is a no-op, not an error.
+	require.NoError(t, m.DeletePolicies(context.Background(), "myhost"))
+}
+
+// fakeEntitlementProvider satisfies subscription.Provider without needing to
+// import the subscription package, since Go interface satisfaction is structural.
+type fakeEntitlementProvider struct {
+	ent map[string]bool
+}
+
+func (p fakeEntitlementProvider) Entitlements(ctx context.Context) (map[string]bool, error) {
+	return p.ent, nil
+}
+
+func TestSimulateApplyDiffsBeforeAndAfter(t *testing.T) {
+	t.Parallel()
+
+	m := &Manager{policiesCacheDir: t.TempDir(), subscriptionProvider: fakeEntitlementProvider{}}
+
+	current := Policies{GPOs: []GPO{{ID: "gpo1", Rules: map[string][]entry.Entry{
+		"dconf": {{Key: "k1", Value: "old"}, {Key: "k2", Value: "unchanged"}},
+	}}}}
+	require.NoError(t, m.PutPolicies(context.Background(), "myhost", current))
+
+	newPols := Policies{GPOs: []GPO{{ID: "gpo1", Rules: map[string][]entry.Entry{
+		"dconf": {{Key: "k1", Value: "new"}, {Key: "k2", Value: "unchanged"}, {Key: "k3", Value: "added"}},
+	}}}}
+
+	diff, err := m.SimulateApply(context.Background(), "myhost", true, newPols)
+	require.NoError(t, err)
+	require.Contains(t, diff, "~ dconf/k1: old -> new")
+	require.Contains(t, diff, "+ dconf/k3: added")
+	require.NotContains(t, diff, "k2", "an unchanged key must not appear in the diff")
+}
+
+func TestSimulateApplyExcludesNonEntitledProKeys(t *testing.T) {
+	t.Parallel()
+
+	m := &Manager{
+		policiesCacheDir:     t.TempDir(),
+		subscriptionProvider: fakeEntitlementProvider{ent: map[string]bool{"privilege": false}},
+	}
+
+	newPols := Policies{GPOs: []GPO{{ID: "gpo1", Rules: map[string][]entry.Entry{
+		"privilege": {{Key: "admins", Value: "alice"}},
+		"dconf":     {{Key: "k1", Value: "v"}},
+	}}}}
+
+	diff, err := m.SimulateApply(context.Background(), "myhost", true, newPols)
+	require.NoError(t, err)
+	require.Contains(t, diff, "+ dconf/k1: v")
+	require.NotContains(t, diff, "privilege", "a Pro-gated rule type must not appear in the diff when the host isn't entitled")
+}
+
+func TestSimulateApplyWithNoPriorCache(t *testing.T) {
+	t.Parallel()
+
+	m := &Manager{policiesCacheDir: t.TempDir(), subscriptionProvider: fakeEntitlementProvider{}}
+
+	newPols := Policies{GPOs: []GPO{{ID: "gpo1", Rules: map[string][]entry.Entry{
+		"dconf": {{Key: "k1", Value: "v"}},
+	}}}}
+
+	diff, err := m.SimulateApply(context.Background(), "myhost", true, newPols)
+	require.NoError(t, err, "a missing prior cache must not be an error, the diff is just empty on the before side")
+	require.Contains(t, diff, "+ dconf/k1: v")
+}
@@ -0,0 +1,201 @@
+// Package scripts allows to materialize and run logon/logoff/startup/shutdown
+// scripts shipped by GPOs.
+package scripts
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ubuntu/adsys/internal/decorate"
+	log "github.com/ubuntu/adsys/internal/grpc/logstreamer"
+	"github.com/ubuntu/adsys/internal/i18n"
+	"github.com/ubuntu/adsys/internal/policies/entry"
+)
+
+// defaultScriptsDir is used when no personalized directory is given to the manager.
+const defaultScriptsDir = "/var/lib/adsys/scripts"
+
+// defaultRunTimeout bounds how long a single script is allowed to run before being killed.
+const defaultRunTimeout = 10 * time.Minute
+
+// Event is one of the lifecycle events a script can be attached to.
+type Event string
+
+// Supported lifecycle events, ordered as they occur during a session.
+const (
+	EventStartup  Event = "startup"
+	EventLogon    Event = "logon"
+	EventLogoff   Event = "logoff"
+	EventShutdown Event = "shutdown"
+)
+
+// Manager prepares scripts on disk and runs them for a given lifecycle event.
+type Manager struct {
+	scriptsDir string
+}
+
+// NewWithScriptsDir returns a new manager with a personalized scripts directory.
+func NewWithScriptsDir(p string) *Manager {
+	if p == "" {
+		p = defaultScriptsDir
+	}
+	return &Manager{
+		scriptsDir: p,
+	}
+}
+
+// script is one entry materialized on disk for a given event, ready to be executed.
+type script struct {
+	order int
+	name  string
+	body  string
+}
+
+// ApplyPolicy generates the scripts for objectName from entries and removes any
+// previously materialized script that is no longer part of the policy.
+//
+// entries' Key is expected to be of the form "<event>/<order>-<name>", Value holds
+// the script body. Within a given event, scripts are run in ascending order.
+func (m *Manager) ApplyPolicy(ctx context.Context, objectName string, isComputer bool, entries []entry.Entry) (err error) {
+	defer decorate.OnError(&err, i18n.G("can't apply scripts policy to %q"), objectName)
+
+	log.Debugf(ctx, "Applying scripts policy to %s (machine: %v)", objectName, isComputer)
+
+	objectDir := filepath.Join(m.scriptsDir, objectName)
+	if err := os.RemoveAll(objectDir); err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+
+	if err := os.MkdirAll(objectDir, 0700); err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		if e.Disabled {
+			continue
+		}
+		event, s, err := parseKey(e.Key)
+		if err != nil {
+			log.Warningf(ctx, "ignoring invalid script entry %q: %v", e.Key, err)
+			continue
+		}
+
+		eventDir := filepath.Join(objectDir, string(event))
+		if err := os.MkdirAll(eventDir, 0700); err != nil {
+			return err
+		}
+		scriptPath := filepath.Join(eventDir, fmt.Sprintf("%03d-%s", s.order, s.name))
+		if err := os.WriteFile(scriptPath, []byte(e.Value), 0700); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ValidateKey reports whether key is a well-formed "<event>/<order>-<name>"
+// script entry key, as expected by ApplyPolicy.
+func ValidateKey(key string) error {
+	_, _, err := parseKey(key)
+	return err
+}
+
+// parseKey splits a "<event>/<order>-<name>" key into its event and ordered script name.
+func parseKey(key string) (Event, script, error) {
+	event, rest, found := strings.Cut(key, "/")
+	if !found {
+		return "", script{}, fmt.Errorf(i18n.G("missing event in key %q"), key)
+	}
+
+	switch Event(event) {
+	case EventStartup, EventLogon, EventLogoff, EventShutdown:
+	default:
+		return "", script{}, fmt.Errorf(i18n.G("unknown script event %q"), event)
+	}
+
+	orderStr, name, found := strings.Cut(rest, "-")
+	if !found {
+		return "", script{}, fmt.Errorf(i18n.G("missing order prefix in key %q"), key)
+	}
+	order, err := strconv.Atoi(orderStr)
+	if err != nil {
+		return "", script{}, fmt.Errorf(i18n.G("invalid order prefix in key %q: %v"), key, err)
+	}
+	// Scripts are stored as "%03d-<name>" and run in file name order, which only
+	// matches numeric order for three-digit orders.
+	if order > 999 {
+		return "", script{}, fmt.Errorf(i18n.G("order prefix in key %q must be between 0 and 999"), key)
+	}
+	if name == "" || name != filepath.Base(name) || name == "." || name == ".." {
+		return "", script{}, fmt.Errorf(i18n.G("invalid script name in key %q: must be a plain file name, not a path"), key)
+	}
+
+	return Event(event), script{order: order, name: name}, nil
+}
+
+// RunScripts executes, in order, every script materialized for objectName and event,
+// logging captured stdout/stderr and the exit status of each script via ctx's logstreamer.
+// A script that fails does not prevent the remaining ones from running; their
+// errors are collected and returned together once every script has run.
+func (m *Manager) RunScripts(ctx context.Context, objectName string, event Event) (err error) {
+	defer decorate.OnError(&err, i18n.G("can't run %q scripts for %q"), event, objectName)
+
+	eventDir := filepath.Join(m.scriptsDir, objectName, string(event))
+	entries, err := os.ReadDir(eventDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+
+	var errs []error
+	for _, name := range names {
+		scriptPath := filepath.Join(eventDir, name)
+		log.Infof(ctx, "Running %s script %s for %s", event, name, objectName)
+
+		runCtx, cancel := context.WithTimeout(ctx, defaultRunTimeout)
+		var stdout, stderr bytes.Buffer
+		cmd := exec.CommandContext(runCtx, scriptPath)
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		runErr := cmd.Run()
+		cancel()
+
+		if stdout.Len() > 0 {
+			log.Debugf(ctx, "%s: %s", name, stdout.String())
+		}
+		if stderr.Len() > 0 {
+			log.Warningf(ctx, "%s: %s", name, stderr.String())
+		}
+		if runErr != nil {
+			log.Warningf(ctx, "script %q failed: %v", name, runErr)
+			errs = append(errs, fmt.Errorf(i18n.G("script %q failed: %v"), name, runErr))
+			continue
+		}
+		log.Infof(ctx, "script %q exited with status 0", name)
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,102 @@
+package scripts_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/ubuntu/adsys/internal/policies/entry"
+	"github.com/ubuntu/adsys/internal/policies/scripts"
+)
+
+func TestValidateKey(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		key     string
+		wantErr bool
+	}{
+		"valid key":                  {key: "logon/10-greeting"},
+		"missing event":              {key: "10-greeting", wantErr: true},
+		"unknown event":              {key: "reboot/10-greeting", wantErr: true},
+		"missing order":              {key: "logon/greeting", wantErr: true},
+		"non numeric order":          {key: "logon/abc-greeting", wantErr: true},
+		"empty name":                 {key: "logon/10-", wantErr: true},
+		"name with path separator":   {key: "logon/1-../../../etc/cron.d/evil", wantErr: true},
+		"name escaping via parent":   {key: "logon/1-..", wantErr: true},
+		"name with nested separator": {key: "logon/1-sub/evil", wantErr: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			err := scripts.ValidateKey(tc.key)
+			if tc.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestApplyPolicyRejectsPathTraversalKey(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	m := scripts.NewWithScriptsDir(dir)
+
+	entries := []entry.Entry{
+		{Key: "logon/1-../../../etc/cron.d/evil", Value: "#!/bin/sh\necho pwned\n"},
+		{Key: "logon/2-greeting", Value: "#!/bin/sh\necho hi\n"},
+	}
+
+	err := m.ApplyPolicy(context.Background(), "myhost", true, entries)
+	require.NoError(t, err)
+
+	_, err = os.Stat(filepath.Join(dir, "..", "..", "..", "etc", "cron.d", "evil"))
+	require.True(t, os.IsNotExist(err), "path traversal key must not escape the object directory")
+
+	_, err = os.Stat(filepath.Join(dir, "myhost", "logon", "002-greeting"))
+	require.NoError(t, err, "the legitimate entry should still be materialized")
+}
+
+// TestRunScriptsRunsAllInOrderAndJoinsFailures writes, via ApplyPolicy, three
+// logon scripts where the last two fail, then checks RunScripts still ran
+// every one of them, in order, and reported every failure.
+func TestRunScriptsRunsAllInOrderAndJoinsFailures(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	m := scripts.NewWithScriptsDir(dir)
+	traceFile := filepath.Join(t.TempDir(), "trace")
+
+	entries := []entry.Entry{
+		{Key: "logon/1-first", Value: fmt.Sprintf("#!/bin/sh\necho first >> %q\n", traceFile)},
+		{Key: "logon/2-second", Value: fmt.Sprintf("#!/bin/sh\necho second >> %q\nexit 1\n", traceFile)},
+		{Key: "logon/3-third", Value: fmt.Sprintf("#!/bin/sh\necho third >> %q\nexit 1\n", traceFile)},
+	}
+	require.NoError(t, m.ApplyPolicy(context.Background(), "myhost", true, entries))
+
+	err := m.RunScripts(context.Background(), "myhost", scripts.EventLogon)
+	require.Error(t, err)
+	require.ErrorContains(t, err, "002-second")
+	require.ErrorContains(t, err, "003-third")
+
+	d, readErr := os.ReadFile(traceFile)
+	require.NoError(t, readErr)
+	require.Equal(t, "first\nsecond\nthird\n", string(d), "every script must run, in order, even after an earlier one failed")
+}
+
+// TestRunScriptsNoScriptsForEventIsNotAnError checks that an event directory
+// that was never materialized (no scripts attached to it) is a no-op.
+func TestRunScriptsNoScriptsForEventIsNotAnError(t *testing.T) {
+	t.Parallel()
+
+	m := scripts.NewWithScriptsDir(t.TempDir())
+	require.NoError(t, m.RunScripts(context.Background(), "myhost", scripts.EventLogon))
+}
@@ -0,0 +1,168 @@
+// Package subscription provides pluggable entitlement backends deciding which
+// Pro-gated policy features are enabled for the current host.
+package subscription
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/ubuntu/adsys/internal/consts"
+	"github.com/ubuntu/adsys/internal/decorate"
+	log "github.com/ubuntu/adsys/internal/grpc/logstreamer"
+	"github.com/ubuntu/adsys/internal/i18n"
+	"gopkg.in/yaml.v3"
+)
+
+// Provider refreshes and returns the set of Pro features the current host is
+// entitled to, keyed by feature name (e.g. "privilege", "scripts", "apparmor").
+type Provider interface {
+	Entitlements(ctx context.Context) (map[string]bool, error)
+}
+
+// UbuntuAdvantageProvider queries entitlement from the com.canonical.UbuntuAdvantage
+// D-Bus service, the historical, all-or-nothing backend.
+type UbuntuAdvantageProvider struct {
+	bus dbus.BusObject
+}
+
+// NewUbuntuAdvantageProvider returns a provider backed by the Ubuntu Advantage D-Bus service.
+func NewUbuntuAdvantageProvider(bus *dbus.Conn) *UbuntuAdvantageProvider {
+	return &UbuntuAdvantageProvider{
+		bus: bus.Object(consts.SubcriptionDbusRegisteredName, dbus.ObjectPath(consts.SubcriptionDbusObjectPath)),
+	}
+}
+
+// Entitlements returns every known feature as enabled when Ubuntu Advantage
+// reports an "enabled" status, since this backend has no notion of per-feature tiers.
+func (p *UbuntuAdvantageProvider) Entitlements(ctx context.Context) (ent map[string]bool, err error) {
+	defer decorate.OnError(&err, i18n.G("can't get entitlements from Ubuntu Advantage"))
+
+	prop, err := p.bus.GetProperty(consts.SubcriptionDbusInterface + ".Status")
+	if err != nil {
+		return nil, fmt.Errorf(i18n.G("no dbus connection to Ubuntu Advantage: %v"), err)
+	}
+	status, ok := prop.Value().(string)
+	if !ok {
+		return nil, fmt.Errorf(i18n.G("dbus returned an improper value from Ubuntu Advantage: %v"), prop.Value())
+	}
+
+	enabled := status == "enabled"
+	return map[string]bool{
+		"privilege": enabled,
+		"scripts":   enabled,
+		"apparmor":  enabled,
+	}, nil
+}
+
+// FileProvider reads per-feature entitlement booleans from a static yaml file,
+// e.g. /etc/adsys/entitlement.yaml.
+type FileProvider struct {
+	path string
+}
+
+// NewFileProvider returns a provider backed by the entitlement file at path.
+func NewFileProvider(path string) *FileProvider {
+	return &FileProvider{path: path}
+}
+
+// Entitlements reads and parses the entitlement file.
+func (p *FileProvider) Entitlements(ctx context.Context) (ent map[string]bool, err error) {
+	defer decorate.OnError(&err, i18n.G("can't get entitlements from %s"), p.path)
+
+	d, err := os.ReadFile(p.path)
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(d, &ent); err != nil {
+		return nil, err
+	}
+	return ent, nil
+}
+
+// HTTPProvider polls a JSON endpoint returning an object of per-feature booleans.
+type HTTPProvider struct {
+	url    string
+	client *http.Client
+}
+
+// NewHTTPProvider returns a provider polling url for a JSON object of feature booleans.
+func NewHTTPProvider(url string) *HTTPProvider {
+	return &HTTPProvider{
+		url:    url,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Entitlements fetches and parses the JSON entitlement document.
+func (p *HTTPProvider) Entitlements(ctx context.Context) (ent map[string]bool, err error) {
+	defer decorate.OnError(&err, i18n.G("can't get entitlements from %s"), p.url)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf(i18n.G("entitlement endpoint returned status %d"), resp.StatusCode)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&ent); err != nil {
+		return nil, err
+	}
+	return ent, nil
+}
+
+// CachedProvider wraps a Provider, keeping the last-known-good entitlements for
+// ttl so a transient backend failure (D-Bus hiccup, network blip) doesn't
+// downgrade an already-entitled host.
+type CachedProvider struct {
+	provider Provider
+	ttl      time.Duration
+
+	mu          sync.Mutex
+	last        map[string]bool
+	lastRefresh time.Time
+}
+
+// NewCachedProvider returns a Provider caching provider's result for ttl.
+func NewCachedProvider(provider Provider, ttl time.Duration) *CachedProvider {
+	return &CachedProvider{
+		provider: provider,
+		ttl:      ttl,
+	}
+}
+
+// Entitlements refreshes from the wrapped provider, falling back to the last
+// known-good value if the refresh fails, or if a refresh isn't due yet.
+func (p *CachedProvider) Entitlements(ctx context.Context) (map[string]bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.last != nil && time.Since(p.lastRefresh) < p.ttl {
+		return p.last, nil
+	}
+
+	ent, err := p.provider.Entitlements(ctx)
+	if err != nil {
+		if p.last != nil {
+			log.Warningf(ctx, "can't refresh entitlements, keeping last known value: %v", err)
+			return p.last, nil
+		}
+		return nil, err
+	}
+
+	p.last = ent
+	p.lastRefresh = time.Now()
+	return ent, nil
+}
@@ -0,0 +1,127 @@
+package subscription_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/ubuntu/adsys/internal/policies/subscription"
+)
+
+type fakeProvider struct {
+	calls int
+	ent   map[string]bool
+	err   error
+}
+
+func (p *fakeProvider) Entitlements(ctx context.Context) (map[string]bool, error) {
+	p.calls++
+	if p.err != nil {
+		return nil, p.err
+	}
+	return p.ent, nil
+}
+
+func TestCachedProviderRefreshesOnceTTLExpires(t *testing.T) {
+	t.Parallel()
+
+	fake := &fakeProvider{ent: map[string]bool{"privilege": true}}
+	p := subscription.NewCachedProvider(fake, time.Millisecond)
+
+	ent, err := p.Entitlements(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, map[string]bool{"privilege": true}, ent)
+	require.Equal(t, 1, fake.calls)
+
+	// Within the TTL, the wrapped provider must not be hit again.
+	_, err = p.Entitlements(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 1, fake.calls, "a call within the TTL window should be served from cache")
+
+	time.Sleep(2 * time.Millisecond)
+	fake.ent = map[string]bool{"privilege": false}
+	ent, err = p.Entitlements(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, map[string]bool{"privilege": false}, ent)
+	require.Equal(t, 2, fake.calls, "a call past the TTL window must refresh from the wrapped provider")
+}
+
+func TestCachedProviderFallsBackToLastKnownGoodOnError(t *testing.T) {
+	t.Parallel()
+
+	fake := &fakeProvider{ent: map[string]bool{"privilege": true}}
+	p := subscription.NewCachedProvider(fake, time.Millisecond)
+
+	ent, err := p.Entitlements(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, map[string]bool{"privilege": true}, ent)
+
+	time.Sleep(2 * time.Millisecond)
+	fake.err = errors.New("boom")
+	ent, err = p.Entitlements(context.Background())
+	require.NoError(t, err, "a refresh failure must not surface once a last known-good value exists")
+	require.Equal(t, map[string]bool{"privilege": true}, ent)
+}
+
+func TestCachedProviderDoesNotFallBackWithoutALastKnownGoodValue(t *testing.T) {
+	t.Parallel()
+
+	fake := &fakeProvider{err: errors.New("boom")}
+	p := subscription.NewCachedProvider(fake, time.Hour)
+
+	_, err := p.Entitlements(context.Background())
+	require.ErrorContains(t, err, "boom", "with no last known-good value yet, the provider error must surface")
+}
+
+func TestFileProviderParsesEntitlementFile(t *testing.T) {
+	t.Parallel()
+
+	p := filepath.Join(t.TempDir(), "entitlement.yaml")
+	require.NoError(t, os.WriteFile(p, []byte("privilege: true\nscripts: false\n"), 0600))
+
+	provider := subscription.NewFileProvider(p)
+	ent, err := provider.Entitlements(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, map[string]bool{"privilege": true, "scripts": false}, ent)
+}
+
+func TestFileProviderMissingFile(t *testing.T) {
+	t.Parallel()
+
+	provider := subscription.NewFileProvider(filepath.Join(t.TempDir(), "does-not-exist.yaml"))
+	_, err := provider.Entitlements(context.Background())
+	require.Error(t, err)
+}
+
+func TestHTTPProviderParsesResponse(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"privilege": true, "apparmor": false}`))
+	}))
+	defer srv.Close()
+
+	provider := subscription.NewHTTPProvider(srv.URL)
+	ent, err := provider.Entitlements(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, map[string]bool{"privilege": true, "apparmor": false}, ent)
+}
+
+func TestHTTPProviderRejectsNonOKStatus(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	provider := subscription.NewHTTPProvider(srv.URL)
+	_, err := provider.Entitlements(context.Background())
+	require.Error(t, err)
+}